@@ -17,14 +17,43 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// +kubebuilder:validation:Enum=Postgres
+// +kubebuilder:validation:Enum=Postgres;MySQL;CockroachDB
 type DatabaseType string
 
 var (
-	DatabaseTypePostgres DatabaseType = "Postgres"
+	DatabaseTypePostgres    DatabaseType = "Postgres"
+	DatabaseTypeMySQL       DatabaseType = "MySQL"
+	DatabaseTypeCockroachDB DatabaseType = "CockroachDB"
+)
+
+// ConditionTypeExtensionsReady reports whether every extension listed in
+// Spec.Extensions was successfully installed. It is False, with a Message
+// naming the offending extensions, when one or more are unavailable in the
+// target cluster.
+const ConditionTypeExtensionsReady = "ExtensionsReady"
+
+// Condition types reported on DatabaseStatus.Conditions.
+const (
+	// ConditionTypeReady is True once a reconcile completed without error.
+	// An extension that is unavailable in the cluster is reported through
+	// ConditionTypeExtensionsReady only and does not make Ready False.
+	ConditionTypeReady = "Ready"
+	// ConditionTypeRoleCreated reports whether the owning role exists and
+	// its password is current.
+	ConditionTypeRoleCreated = "RoleCreated"
+	// ConditionTypeDatabaseCreated reports whether the database exists.
+	ConditionTypeDatabaseCreated = "DatabaseCreated"
+	// ConditionTypeSecretSynced reports whether the credentials Secret
+	// matches Spec.SecretTemplate and the current password.
+	ConditionTypeSecretSynced = "SecretSynced"
+	// ConditionTypeRotating is True while a password rotation is in
+	// progress, and False with a reason of either RotationComplete or
+	// RotationDisabled otherwise.
+	ConditionTypeRotating = "Rotating"
 )
 
 // DatabaseSpec defines the desired state of Database
@@ -34,11 +63,48 @@ type DatabaseSpec struct {
 	// Extensions are the list of extensions required
 	// +optional
 	Extensions []string `json:"extensions,omitempty"`
+
+	// InstanceRef names the DatabaseInstance this database is provisioned
+	// against, in the same namespace. If empty, the reconciler's default
+	// backend instance is used, preserving the behavior of Database CRs
+	// created before DatabaseInstance existed.
+	// +optional
+	InstanceRef corev1.LocalObjectReference `json:"instanceRef,omitempty"`
+
+	// SecretTemplate customizes the keys and values written to the
+	// credentials Secret. Each value is rendered with Go text/template
+	// against a SecretTemplateContext, so application-specific formats
+	// (a single DATABASE_URL, a Rails database.yml, ...) can be produced
+	// without a sidecar transformer. If empty, DefaultSecretTemplate is
+	// used.
+	// +optional
+	SecretTemplate map[string]string `json:"secretTemplate,omitempty"`
+
+	// RotationInterval, if set, causes the owning role's password to be
+	// regenerated and rewritten to the credentials Secret once this much
+	// time has passed since Status.LastRotated.
+	// +optional
+	RotationInterval *metav1.Duration `json:"rotationInterval,omitempty"`
 }
 
 // DatabaseStatus defines the observed state of Database
 type DatabaseStatus struct {
 	Provisioned *bool `json:"provisioned"`
+
+	// InstalledExtensions is the list of extensions currently installed in
+	// the database, reflecting Spec.Extensions once reconciled.
+	// +optional
+	InstalledExtensions []string `json:"installedExtensions,omitempty"`
+
+	// Conditions represent the latest available observations of the
+	// database's state.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// LastRotated is the time the owning role's password was last
+	// generated and written to the credentials Secret.
+	// +optional
+	LastRotated *metav1.Time `json:"lastRotated,omitempty"`
 }
 
 // +kubebuilder:object:root=true
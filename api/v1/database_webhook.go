@@ -0,0 +1,79 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+var databaselog = logf.Log.WithName("database-resource")
+
+func (r *Database) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-platform-dev-env-v1-database,mutating=false,failurePolicy=fail,sideEffects=None,groups=platform.dev.env,resources=databases,verbs=create;update,versions=v1,name=vdatabase.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &Database{}
+
+// ValidateCreate implements webhook.Validator
+func (r *Database) ValidateCreate() error {
+	databaselog.Info("validate create", "name", r.Name)
+	return r.validateSecretTemplate()
+}
+
+// ValidateUpdate implements webhook.Validator
+func (r *Database) ValidateUpdate(old runtime.Object) error {
+	databaselog.Info("validate update", "name", r.Name)
+	return r.validateSecretTemplate()
+}
+
+// ValidateDelete implements webhook.Validator
+func (r *Database) ValidateDelete() error {
+	return nil
+}
+
+// validateSecretTemplate rejects a SecretTemplate that references a field
+// other than those exposed on SecretTemplateContext, by rendering it against
+// a sample context and surfacing any execution error.
+func (r *Database) validateSecretTemplate() error {
+	if len(r.Spec.SecretTemplate) == 0 {
+		return nil
+	}
+
+	sample := SecretTemplateContext{
+		Host:      "sample-host",
+		Port:      5432,
+		Database:  "sample-database",
+		User:      "sample-user",
+		Password:  "sample-password",
+		Namespace: r.Namespace,
+		Name:      r.Name,
+	}
+
+	if _, err := RenderSecretTemplate(r.Spec.SecretTemplate, sample); err != nil {
+		return fmt.Errorf("spec.secretTemplate: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +kubebuilder:validation:Enum=disable;require;verify-ca;verify-full
+type SSLMode string
+
+var (
+	// SSLModeDisable makes no attempt to use TLS.
+	SSLModeDisable SSLMode = "disable"
+	// SSLModeRequire encrypts the connection but does not verify the
+	// server's certificate chain or hostname.
+	SSLModeRequire SSLMode = "require"
+	// SSLModeVerifyCA encrypts the connection and verifies the server's
+	// certificate chain against CABundleConfigMapRef, but not its hostname.
+	SSLModeVerifyCA SSLMode = "verify-ca"
+	// SSLModeVerifyFull encrypts the connection and verifies both the
+	// server's certificate chain against CABundleConfigMapRef and that its
+	// hostname matches Host.
+	SSLModeVerifyFull SSLMode = "verify-full"
+)
+
+// DatabaseInstanceSpec defines the desired state of DatabaseInstance.
+// SSLMode, CABundleConfigMapRef, ConnectTimeout and ApplicationName are
+// applied to Postgres and CockroachDB connections only; MySQL connections
+// ignore them.
+type DatabaseInstanceSpec struct {
+	// Host is the address of the backend instance.
+	Host string `json:"host"`
+	// Port is the port the backend instance listens on.
+	Port uint16 `json:"port"`
+
+	// SuperuserSecretRef references a Secret in the same namespace holding
+	// superuser credentials for this instance, under the PGUSER and
+	// PGPASSWORD keys.
+	SuperuserSecretRef corev1.LocalObjectReference `json:"superuserSecretRef"`
+
+	// SSLMode controls whether and how connections to this instance are
+	// encrypted and verified.
+	// +optional
+	// +kubebuilder:default=disable
+	SSLMode SSLMode `json:"sslMode,omitempty"`
+
+	// CABundleConfigMapRef references a ConfigMap in the same namespace
+	// holding the CA bundle to verify the server's certificate against,
+	// under a ca.crt key. Required when SSLMode is verify-ca or
+	// verify-full.
+	// +optional
+	CABundleConfigMapRef *corev1.LocalObjectReference `json:"caBundleConfigMapRef,omitempty"`
+
+	// ConnectTimeout bounds how long a new connection attempt to this
+	// instance may take. Defaults to the driver's own default when unset.
+	// +optional
+	ConnectTimeout *metav1.Duration `json:"connectTimeout,omitempty"`
+
+	// ApplicationName is reported to the backend via the application_name
+	// connection parameter, so sessions opened against this instance are
+	// identifiable in pg_stat_activity and slow-query logs.
+	// +optional
+	ApplicationName string `json:"applicationName,omitempty"`
+}
+
+// DatabaseInstanceStatus defines the observed state of DatabaseInstance
+type DatabaseInstanceStatus struct {
+	// Conditions represent the latest available observations of the
+	// instance's state.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// DatabaseInstance is the Schema for the databaseinstances API
+type DatabaseInstance struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DatabaseInstanceSpec   `json:"spec,omitempty"`
+	Status DatabaseInstanceStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// DatabaseInstanceList contains a list of DatabaseInstance
+type DatabaseInstanceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DatabaseInstance `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DatabaseInstance{}, &DatabaseInstanceList{})
+}
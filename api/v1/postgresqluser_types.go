@@ -0,0 +1,136 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +kubebuilder:validation:Enum=SCHEMA;TABLE;SEQUENCE;DATABASE
+type GrantObjectType string
+
+var (
+	GrantObjectSchema   GrantObjectType = "SCHEMA"
+	GrantObjectTable    GrantObjectType = "TABLE"
+	GrantObjectSequence GrantObjectType = "SEQUENCE"
+	GrantObjectDatabase GrantObjectType = "DATABASE"
+)
+
+// +kubebuilder:validation:Enum=SELECT;INSERT;UPDATE;DELETE;TRUNCATE;REFERENCES;TRIGGER;USAGE;CREATE;CONNECT;TEMPORARY;EXECUTE;ALL
+type Privilege string
+
+var (
+	PrivilegeSelect     Privilege = "SELECT"
+	PrivilegeInsert     Privilege = "INSERT"
+	PrivilegeUpdate     Privilege = "UPDATE"
+	PrivilegeDelete     Privilege = "DELETE"
+	PrivilegeTruncate   Privilege = "TRUNCATE"
+	PrivilegeReferences Privilege = "REFERENCES"
+	PrivilegeTrigger    Privilege = "TRIGGER"
+	PrivilegeUsage      Privilege = "USAGE"
+	PrivilegeCreate     Privilege = "CREATE"
+	PrivilegeConnect    Privilege = "CONNECT"
+	PrivilegeTemporary  Privilege = "TEMPORARY"
+	PrivilegeExecute    Privilege = "EXECUTE"
+	// PrivilegeAll grants every privilege that applies to Object, expanded to
+	// the concrete set at reconcile time so it converges the same way an
+	// explicit list would rather than diffing as an opaque string.
+	PrivilegeAll Privilege = "ALL"
+)
+
+// Grant describes a set of privileges a PostgreSQLUser holds over a single
+// database object.
+type Grant struct {
+	// Privileges is the list of privileges to grant, for example SELECT,
+	// INSERT, UPDATE, or ALL.
+	Privileges []Privilege `json:"privileges"`
+	// Object is the kind of object the privileges apply to.
+	Object GrantObjectType `json:"object"`
+	// ObjectName is the name of the object. For TABLE, it may be
+	// schema-qualified as "schema.table"; an unqualified name defaults to
+	// the public schema. Ignored when Object is DATABASE, since the grant
+	// applies to the database referenced by DatabaseRef.
+	// +optional
+	ObjectName string `json:"objectName,omitempty"`
+	// WithGrantOption, if true, grants WITH GRANT OPTION so the user can
+	// delegate the privileges to other roles.
+	// +optional
+	WithGrantOption bool `json:"withGrantOption,omitempty"`
+}
+
+// PostgreSQLUserSpec defines the desired state of PostgreSQLUser
+type PostgreSQLUserSpec struct {
+	// DatabaseRef is the name of the Database this user is provisioned
+	// against. The Database must exist in the same namespace.
+	DatabaseRef corev1.LocalObjectReference `json:"databaseRef"`
+
+	// Credentials references the Secret the generated username/password pair
+	// is written to. Defaults to postgresqluser-creds-<name> if omitted.
+	// +optional
+	Credentials corev1.LocalObjectReference `json:"credentials,omitempty"`
+
+	// Grants is the list of privilege grants this user should hold. Grants
+	// not listed here are revoked.
+	// +optional
+	Grants []Grant `json:"grants,omitempty"`
+
+	// RotationInterval, if set, causes the role's password to be regenerated
+	// and rewritten to Credentials once this long since it was last rotated.
+	// If unset, the password is generated once and never rotated.
+	// +optional
+	RotationInterval *metav1.Duration `json:"rotationInterval,omitempty"`
+}
+
+// PostgreSQLUserStatus defines the observed state of PostgreSQLUser
+type PostgreSQLUserStatus struct {
+	Provisioned *bool `json:"provisioned"`
+
+	// Conditions represent the latest available observations of the user's
+	// state.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// LastRotated records when the role's password was last generated.
+	// +optional
+	LastRotated *metav1.Time `json:"lastRotated,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// PostgreSQLUser is the Schema for the postgresqlusers API
+type PostgreSQLUser struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PostgreSQLUserSpec   `json:"spec,omitempty"`
+	Status PostgreSQLUserStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// PostgreSQLUserList contains a list of PostgreSQLUser
+type PostgreSQLUserList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PostgreSQLUser `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PostgreSQLUser{}, &PostgreSQLUserList{})
+}
@@ -0,0 +1,72 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// SecretTemplateContext is the data made available to DatabaseSpec.SecretTemplate
+// entries when rendering a Database's credentials Secret.
+type SecretTemplateContext struct {
+	Host      string
+	Port      uint16
+	Database  string
+	User      string
+	Password  string
+	Namespace string
+	Name      string
+}
+
+// DefaultSecretTemplate is used when DatabaseSpec.SecretTemplate is empty,
+// preserving the PGHOST/PGPORT/PGDATABASE/PGUSER/PGPASSWORD keys existing
+// consumers rely on.
+var DefaultSecretTemplate = map[string]string{
+	"PGHOST":     "{{.Host}}",
+	"PGPORT":     "{{.Port}}",
+	"PGDATABASE": "{{.Database}}",
+	"PGUSER":     "{{.User}}",
+	"PGPASSWORD": "{{.Password}}",
+}
+
+// RenderSecretTemplate renders each entry of tmpl against ctx, returning the
+// rendered bytes keyed by the same Secret data key. An empty tmpl falls back
+// to DefaultSecretTemplate. Templates referencing fields not present on
+// SecretTemplateContext fail to render, which RenderSecretTemplate surfaces
+// as an error so it can be used both to build the Secret and to validate
+// SecretTemplate at admission time.
+func RenderSecretTemplate(tmpl map[string]string, ctx SecretTemplateContext) (map[string][]byte, error) {
+	if len(tmpl) == 0 {
+		tmpl = DefaultSecretTemplate
+	}
+
+	data := make(map[string][]byte, len(tmpl))
+	for key, tmplStr := range tmpl {
+		t, err := template.New(key).Option("missingkey=error").Parse(tmplStr)
+		if err != nil {
+			return nil, fmt.Errorf("parse secret template %q: %w", key, err)
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, ctx); err != nil {
+			return nil, fmt.Errorf("render secret template %q: %w", key, err)
+		}
+		data[key] = buf.Bytes()
+	}
+	return data, nil
+}
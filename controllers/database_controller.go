@@ -18,16 +18,19 @@ package controllers
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"strconv"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
-	"github.com/jackc/pgx/v4"
-	"github.com/jackc/pgx/v4/pgxpool"
 	platformv1 "github.com/jaym/kube-dev-env/api/v1"
+	"github.com/jaym/kube-dev-env/pkg/password"
+	"github.com/jaym/kube-dev-env/pkg/provisioner"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -35,6 +38,12 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
+// passwordSecretKey is the Secret data key under which the current plaintext
+// password is kept, independent of Spec.SecretTemplate, so it can be reused
+// across reconciles without re-deriving it from a user-customizable
+// template.
+const passwordSecretKey = "_password"
+
 type PGConfig struct {
 	Host     string
 	Port     uint16
@@ -48,20 +57,194 @@ type DatabaseReconciler struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
-	// PGConfig is configuration to connect to a postgres instance
-	// with superuser credentials
+	// PGConfig is configuration to connect to the default backend instance
+	// with superuser credentials, used when a Database does not set
+	// Spec.InstanceRef.
 	PGConfig PGConfig
+	// PasswordLength and PasswordCharset configure generated passwords; see
+	// password.Generate for their defaults when left zero.
+	PasswordLength  int
+	PasswordCharset string
+
+	provisioners provisionerCache
+}
 
-	db *pgxpool.Pool
+// provisionerCacheKey identifies a cached provisioner by backend type and
+// instance. instance is the zero client.ObjectKey for Database/PostgreSQLUser
+// CRs that don't set Spec.InstanceRef, which all share the reconciler's
+// default PGConfig. version changes whenever the DatabaseInstance or its
+// superuser Secret is updated, so a stale pool is evicted and rebuilt
+// rather than reused silently.
+type provisionerCacheKey struct {
+	dbType   platformv1.DatabaseType
+	instance client.ObjectKey
+	version  string
 }
 
-func (c *PGConfig) ToSecret(secKey client.ObjectKey) *corev1.Secret {
-	data := map[string][]byte{
-		"PGHOST":     []byte(c.Host),
-		"PGPORT":     []byte(strconv.Itoa(int(c.Port))),
-		"PGDATABASE": []byte(c.Database),
-		"PGUSER":     []byte(c.User),
-		"PGPASSWORD": []byte(c.Password),
+// provisionerCache builds and caches DatabaseProvisioners by
+// provisionerCacheKey. DatabaseReconciler and PostgreSQLUserReconciler,
+// which both provision against the same set of DatabaseInstances, each hold
+// their own provisionerCache, so their pools are not shared.
+type provisionerCache struct {
+	mu    sync.Mutex
+	byKey map[provisionerCacheKey]provisioner.DatabaseProvisioner
+}
+
+// getOrCreate returns the provisioner cached for key, building, ping-ing,
+// and caching one from cfg on first use. A cached provisioner for the same
+// (dbType, instance) but a stale version is closed and evicted first.
+func (c *provisionerCache) getOrCreate(ctx context.Context, key provisionerCacheKey, cfg provisioner.Config) (provisioner.DatabaseProvisioner, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if p, ok := c.byKey[key]; ok {
+		return p, nil
+	}
+
+	p, err := provisioner.New(key.dbType, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Ping(ctx); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("ping new pool for instance %s: %w", key.instance, err)
+	}
+
+	for k, existing := range c.byKey {
+		if k.dbType == key.dbType && k.instance == key.instance {
+			existing.Close()
+			delete(c.byKey, k)
+		}
+	}
+
+	if c.byKey == nil {
+		c.byKey = map[provisionerCacheKey]provisioner.DatabaseProvisioner{}
+	}
+	c.byKey[key] = p
+	return p, nil
+}
+
+// closeAll closes and removes every cached provisioner.
+func (c *provisionerCache) closeAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, p := range c.byKey {
+		p.Close()
+		delete(c.byKey, k)
+	}
+}
+
+// resolveInstanceConfig returns the superuser connection details a
+// reconciler should provision through, along with the cache key
+// identifying that instance. When instanceRefName is set, host, port,
+// superuser credentials, and TLS settings are resolved from the named
+// DatabaseInstance in namespace; otherwise fallback is used, preserving the
+// behavior of CRs created before DatabaseInstance existed.
+func resolveInstanceConfig(ctx context.Context, c client.Client, namespace, instanceRefName string, dbType platformv1.DatabaseType, fallback PGConfig) (provisioner.Config, provisionerCacheKey, error) {
+	if dbType == "" {
+		dbType = platformv1.DatabaseTypePostgres
+	}
+
+	if instanceRefName == "" {
+		cfg := provisioner.Config{
+			Host:     fallback.Host,
+			Port:     fallback.Port,
+			Database: fallback.Database,
+			User:     fallback.User,
+			Password: fallback.Password,
+		}
+		return cfg, provisionerCacheKey{dbType: dbType}, nil
+	}
+
+	instanceKey := client.ObjectKey{Namespace: namespace, Name: instanceRefName}
+	var instance platformv1.DatabaseInstance
+	if err := c.Get(ctx, instanceKey, &instance); err != nil {
+		return provisioner.Config{}, provisionerCacheKey{}, fmt.Errorf("get database instance %s: %w", instanceKey, err)
+	}
+
+	var sec corev1.Secret
+	secKey := client.ObjectKey{Namespace: namespace, Name: instance.Spec.SuperuserSecretRef.Name}
+	if err := c.Get(ctx, secKey, &sec); err != nil {
+		return provisioner.Config{}, provisionerCacheKey{}, fmt.Errorf("get superuser secret %s: %w", secKey, err)
+	}
+
+	cfg := provisioner.Config{
+		Host:            instance.Spec.Host,
+		Port:            instance.Spec.Port,
+		Database:        fallback.Database,
+		User:            string(sec.Data["PGUSER"]),
+		Password:        string(sec.Data["PGPASSWORD"]),
+		SSLMode:         instance.Spec.SSLMode,
+		ApplicationName: instance.Spec.ApplicationName,
+	}
+	if instance.Spec.ConnectTimeout != nil {
+		cfg.ConnectTimeout = instance.Spec.ConnectTimeout.Duration
+	}
+	if instance.Spec.CABundleConfigMapRef != nil {
+		var cm corev1.ConfigMap
+		cmKey := client.ObjectKey{Namespace: namespace, Name: instance.Spec.CABundleConfigMapRef.Name}
+		if err := c.Get(ctx, cmKey, &cm); err != nil {
+			return provisioner.Config{}, provisionerCacheKey{}, fmt.Errorf("get ca bundle configmap %s: %w", cmKey, err)
+		}
+		cfg.CABundle = []byte(cm.Data["ca.crt"])
+	}
+
+	key := provisionerCacheKey{
+		dbType:   dbType,
+		instance: instanceKey,
+		version:  instance.ResourceVersion + "/" + sec.ResourceVersion,
+	}
+	return cfg, key, nil
+}
+
+// resolveInstance returns the superuser connection details db should be
+// provisioned through along with the cache key identifying that instance.
+func (r *DatabaseReconciler) resolveInstance(ctx context.Context, db *platformv1.Database) (provisioner.Config, provisionerCacheKey, error) {
+	return resolveInstanceConfig(ctx, r.Client, db.Namespace, db.Spec.InstanceRef.Name, db.Spec.Type, r.PGConfig)
+}
+
+// provisionerFor returns the DatabaseProvisioner for db, building and
+// caching one on first use per resolveInstance's cache key. dbType defaults
+// to Postgres to preserve the behavior of Database CRs created before
+// Spec.Type existed.
+func (r *DatabaseReconciler) provisionerFor(ctx context.Context, db *platformv1.Database) (provisioner.DatabaseProvisioner, error) {
+	cfg, key, err := r.resolveInstance(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	return r.provisioners.getOrCreate(ctx, key, cfg)
+}
+
+// Start implements manager.Runnable, closing every cached provisioner pool
+// when the manager shuts down. Register it alongside the reconciler via
+// mgr.Add(r) in SetupWithManager's caller.
+func (r *DatabaseReconciler) Start(ctx context.Context) error {
+	<-ctx.Done()
+	r.provisioners.closeAll()
+	return nil
+}
+
+// ConnString returns a postgres connection URI for this config, suitable for
+// pgx.Connect or pgxpool.ParseConfig.
+func (c *PGConfig) ConnString() string {
+	return fmt.Sprintf("postgres://%s:%s@%s:%d/%s",
+		url.QueryEscape(c.User), url.QueryEscape(c.Password), c.Host, c.Port, url.QueryEscape(c.Database))
+}
+
+// ToSecret renders a credentials Secret for secKey, using tmpl to format its
+// data if non-empty or platformv1.DefaultSecretTemplate otherwise.
+func (c *PGConfig) ToSecret(secKey client.ObjectKey, tmpl map[string]string) (*corev1.Secret, error) {
+	data, err := platformv1.RenderSecretTemplate(tmpl, platformv1.SecretTemplateContext{
+		Host:      c.Host,
+		Port:      c.Port,
+		Database:  c.Database,
+		User:      c.User,
+		Password:  c.Password,
+		Namespace: secKey.Namespace,
+		Name:      secKey.Name,
+	})
+	if err != nil {
+		return nil, err
 	}
 	return &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
@@ -70,11 +253,13 @@ func (c *PGConfig) ToSecret(secKey client.ObjectKey) *corev1.Secret {
 		},
 		Data: data,
 		Type: "Opaque",
-	}
+	}, nil
 }
 
 // +kubebuilder:rbac:groups=platform.dev.env,resources=databases,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=platform.dev.env,resources=databases/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=platform.dev.env,resources=databaseinstances,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
 
 func (r *DatabaseReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
@@ -86,121 +271,232 @@ func (r *DatabaseReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		return ctrl.Result{}, err
 	}
 
-	var sec corev1.Secret
-	secKey := objectKeyForDatabaseSecret(req.NamespacedName)
-	if err := r.Client.Get(ctx, secKey, &sec); err != nil {
-		if !apierrors.IsNotFound(err) {
-			return ctrl.Result{}, err
-		}
-		sec := corev1.Secret{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      secKey.Name,
-				Namespace: secKey.Namespace,
-			},
-			Data: map[string][]byte{
-				"foo": []byte("bar"),
-			},
-			Type: "Opaque",
-		}
+	reconcileErr := r.ensureDatabaseAndSecret(ctx, log, &db)
+	if reconcileErr == nil {
+		reconcileErr = r.ensureExtensions(ctx, log, &db)
+	}
 
-		if err := controllerutil.SetControllerReference(&db, &sec, r.Scheme); err != nil {
-			log.Error(err, "failed to set controller")
-		}
+	readyCond := metav1.Condition{
+		Type:   platformv1.ConditionTypeReady,
+		Status: metav1.ConditionTrue,
+		Reason: "ReconcileSucceeded",
+	}
+	if reconcileErr != nil {
+		readyCond.Status = metav1.ConditionFalse
+		readyCond.Reason = "ReconcileError"
+		readyCond.Message = reconcileErr.Error()
+	}
+	meta.SetStatusCondition(&db.Status.Conditions, readyCond)
 
-		if err := r.Client.Create(ctx, &sec); err != nil {
-			log.Error(err, "failed to create secret")
-			return ctrl.Result{}, err
+	if err := r.Client.Status().Update(ctx, &db); err != nil {
+		log.Error(err, "failed to update database status")
+		if reconcileErr == nil {
+			reconcileErr = err
 		}
+	}
 
-		return ctrl.Result{}, nil
-	} else {
-		log.Info("got secret", "foo", string(sec.Data["foo"]))
+	if reconcileErr != nil {
+		// Returning the error re-queues through the default rate-limiting
+		// workqueue, which backs off exponentially on repeated failures.
+		return ctrl.Result{}, reconcileErr
 	}
 
-	return ctrl.Result{}, nil
+	result := ctrl.Result{}
+	if db.Spec.RotationInterval != nil {
+		result.RequeueAfter = db.Spec.RotationInterval.Duration
+	}
+	return result, nil
 }
 
-func (r *DatabaseReconciler) ensureDatabaseAndSecret(ctx context.Context, log logr.Logger, databaseObjKey client.ObjectKey) error {
-	resetPassword := false
-	createRole := false
-	createDatabase := false
-	secExists := true
+// ensureExtensions reconciles db.Spec.Extensions against the extensions
+// actually installed in db's database, installing newly requested ones,
+// dropping ones that were removed from the spec, and recording the result
+// on db.Status. It mutates db.Status in place; the caller is responsible for
+// persisting it.
+func (r *DatabaseReconciler) ensureExtensions(ctx context.Context, log logr.Logger, db *platformv1.Database) error {
+	cfg, err := r.pgConnConfigFor(ctx, db)
+	if err != nil {
+		log.Error(err, "failed to resolve instance connection details")
+		return err
+	}
+
+	p, err := r.provisionerFor(ctx, db)
+	if err != nil {
+		log.Error(err, "failed to get provisioner", "type", db.Spec.Type)
+		return err
+	}
+
+	installed, unavailable, err := p.EnsureExtensions(ctx, cfg.Database, db.Status.InstalledExtensions, db.Spec.Extensions)
+	if err != nil {
+		log.Error(err, "failed to reconcile extensions", "database", cfg.Database)
+		return err
+	}
+	for _, ext := range unavailable {
+		log.Info("extension unavailable in cluster", "extension", ext)
+	}
+
+	db.Status.InstalledExtensions = installed
+
+	cond := metav1.Condition{
+		Type:   platformv1.ConditionTypeExtensionsReady,
+		Status: metav1.ConditionTrue,
+		Reason: "ExtensionsInstalled",
+	}
+	if len(unavailable) > 0 {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = "ExtensionUnavailable"
+		cond.Message = fmt.Sprintf("extensions not available in cluster: %s", strings.Join(unavailable, ", "))
+	}
+	meta.SetStatusCondition(&db.Status.Conditions, cond)
+
+	return nil
+}
+
+func (r *DatabaseReconciler) ensureDatabaseAndSecret(ctx context.Context, log logr.Logger, db *platformv1.Database) error {
+	databaseObjKey := client.ObjectKeyFromObject(db)
+	cfg, err := r.pgConnConfigFor(ctx, db)
+	if err != nil {
+		log.Error(err, "failed to resolve instance connection details")
+		return err
+	}
+
+	p, err := r.provisionerFor(ctx, db)
+	if err != nil {
+		log.Error(err, "failed to get provisioner", "type", db.Spec.Type)
+		return err
+	}
 
-	var sec corev1.Secret
 	secKey := objectKeyForDatabaseSecret(databaseObjKey)
+	var sec corev1.Secret
+	secExists := true
 	if err := r.Client.Get(ctx, secKey, &sec); err != nil {
 		if !apierrors.IsNotFound(err) {
 			return err
 		}
-		resetPassword = true
 		secExists = false
 	}
 
-	cfg := r.pgConnConfigFor(databaseObjKey)
-
-	var unused string
-	row := r.db.QueryRow(ctx, `SELECT rolname FROM pg_catalog.pgauthid WHERE rolname=$1`, cfg.User)
-	if err := row.Scan(&unused); err != nil {
-		if !errors.Is(err, pgx.ErrNoRows) {
-			log.Error(err, "could not check if role exists", "role", cfg.User)
-			return err
-		}
-		resetPassword = true
-		createRole = true
+	rotate := !secExists || db.Status.LastRotated == nil
+	if !rotate && db.Spec.RotationInterval != nil {
+		rotate = time.Since(db.Status.LastRotated.Time) >= db.Spec.RotationInterval.Duration
 	}
 
-	row = r.db.QueryRow(ctx, `SELECT datname FROM pg_catalog.pg_database WHERE datname=$1`, cfg.Database)
-	if err := row.Scan(&unused); err != nil {
-		if !errors.Is(err, pgx.ErrNoRows) {
-			log.Error(err, "could not check if database exists", "database", cfg.User)
+	if rotate {
+		meta.SetStatusCondition(&db.Status.Conditions, metav1.Condition{
+			Type:   platformv1.ConditionTypeRotating,
+			Status: metav1.ConditionTrue,
+			Reason: "RotatingPassword",
+		})
+		newPassword, err := password.Generate(r.PasswordLength, r.PasswordCharset)
+		if err != nil {
+			log.Error(err, "failed to generate password")
 			return err
 		}
-		createDatabase = true
+		cfg.Password = newPassword
+	} else if existing, ok := sec.Data[passwordSecretKey]; ok {
+		cfg.Password = string(existing)
+	} else {
+		err := fmt.Errorf("secret %s is missing the reserved %q key", secKey, passwordSecretKey)
+		log.Error(err, "cannot reuse existing password")
+		return err
 	}
 
-	if createRole {
-		if _, err := r.db.Exec(ctx, fmt.Sprintf("CREATE USER %q", cfg.User)); err != nil {
-			log.Error(err, "failed to create role", "role", cfg.User)
-			return err
-		}
+	if err := p.EnsureRole(ctx, cfg.User, cfg.Password); err != nil {
+		log.Error(err, "failed to ensure role", "role", cfg.User)
+		meta.SetStatusCondition(&db.Status.Conditions, metav1.Condition{
+			Type: platformv1.ConditionTypeRoleCreated, Status: metav1.ConditionFalse, Reason: "EnsureRoleFailed", Message: err.Error(),
+		})
+		return err
 	}
-
-	if resetPassword {
-		if _, err := r.db.Exec(ctx, fmt.Sprintf(
-			`ALTER USER "%s" WITH PASSWORD '%s'`, cfg.User, cfg.Password)); err != nil {
-
-			log.Error(err, "failed to change role password", "role", cfg.User)
-			return err
-		}
+	meta.SetStatusCondition(&db.Status.Conditions, metav1.Condition{
+		Type: platformv1.ConditionTypeRoleCreated, Status: metav1.ConditionTrue, Reason: "RoleEnsured",
+	})
+
+	if err := p.EnsureDatabase(ctx, cfg.Database, cfg.User); err != nil {
+		log.Error(err, "failed to ensure database", "database", cfg.Database)
+		meta.SetStatusCondition(&db.Status.Conditions, metav1.Condition{
+			Type: platformv1.ConditionTypeDatabaseCreated, Status: metav1.ConditionFalse, Reason: "EnsureDatabaseFailed", Message: err.Error(),
+		})
+		return err
+	}
+	meta.SetStatusCondition(&db.Status.Conditions, metav1.Condition{
+		Type: platformv1.ConditionTypeDatabaseCreated, Status: metav1.ConditionTrue, Reason: "DatabaseEnsured",
+	})
+
+	newSec, err := cfg.ToSecret(secKey, db.Spec.SecretTemplate)
+	if err != nil {
+		log.Error(err, "failed to render secret template")
+		return err
 	}
+	newSec.Data[passwordSecretKey] = []byte(cfg.Password)
 
-	if createDatabase {
-		if _, err := r.db.Exec(ctx, fmt.Sprintf(
-			`CREATE DATABASE %q OWNER %q`, cfg.Database, cfg.User)); err != nil {
-			log.Error(err, "failed to create database", "role", cfg.User)
+	if !secExists {
+		if err := controllerutil.SetControllerReference(db, newSec, r.Scheme); err != nil {
+			log.Error(err, "failed to set controller reference on secret")
+		}
+		if err := r.Client.Create(ctx, newSec); err != nil {
+			log.Error(err, "failed to create secret")
+			meta.SetStatusCondition(&db.Status.Conditions, metav1.Condition{
+				Type: platformv1.ConditionTypeSecretSynced, Status: metav1.ConditionFalse, Reason: "CreateFailed", Message: err.Error(),
+			})
 			return err
 		}
-	}
-
-	if secExists {
-		r.Client.Update(ctx, &sec)
 	} else {
-		sec := cfg.ToSecret(secKey)
-		if err := r.Client.Create(ctx, sec); err != nil {
-			log.Error(err, "failed to create secret")
+		sec.Data = newSec.Data
+		if err := r.Client.Update(ctx, &sec); err != nil {
+			log.Error(err, "failed to update secret")
+			meta.SetStatusCondition(&db.Status.Conditions, metav1.Condition{
+				Type: platformv1.ConditionTypeSecretSynced, Status: metav1.ConditionFalse, Reason: "UpdateFailed", Message: err.Error(),
+			})
 			return err
 		}
 	}
+	meta.SetStatusCondition(&db.Status.Conditions, metav1.Condition{
+		Type: platformv1.ConditionTypeSecretSynced, Status: metav1.ConditionTrue, Reason: "SecretSynced",
+	})
+
+	if rotate {
+		now := metav1.Now()
+		db.Status.LastRotated = &now
+		meta.SetStatusCondition(&db.Status.Conditions, metav1.Condition{
+			Type: platformv1.ConditionTypeRotating, Status: metav1.ConditionFalse, Reason: "RotationComplete",
+		})
+	} else if db.Spec.RotationInterval == nil {
+		meta.SetStatusCondition(&db.Status.Conditions, metav1.Condition{
+			Type: platformv1.ConditionTypeRotating, Status: metav1.ConditionFalse, Reason: "RotationDisabled",
+		})
+	}
+
+	provisioned := true
+	db.Status.Provisioned = &provisioned
 
 	return nil
 }
 
-func (r *DatabaseReconciler) pgConnConfigFor(databaseObjKey client.ObjectKey) PGConfig {
-	var cfg PGConfig
-	cfg = r.PGConfig
-	cfg.User = roleNameForObjectKey(databaseObjKey)
-	cfg.Password = roleNameForObjectKey(databaseObjKey)
-	return cfg
+// pgConnConfigFor returns connection details for db's database and role, on
+// whichever instance db.Spec.InstanceRef resolves to. The caller is
+// responsible for setting Password, since it may need to be generated or
+// read back from the existing Secret.
+func (r *DatabaseReconciler) pgConnConfigFor(ctx context.Context, db *platformv1.Database) (PGConfig, error) {
+	instanceCfg, _, err := r.resolveInstance(ctx, db)
+	if err != nil {
+		return PGConfig{}, err
+	}
+
+	databaseObjKey := client.ObjectKeyFromObject(db)
+	return PGConfig{
+		Host:     instanceCfg.Host,
+		Port:     instanceCfg.Port,
+		Database: databaseNameForObjectKey(databaseObjKey),
+		User:     roleNameForObjectKey(databaseObjKey),
+	}, nil
+}
+
+// quoteIdentifier quotes name for safe interpolation into a SQL statement as
+// an identifier (role, database, or extension name), equivalent to
+// pq.QuoteIdentifier. It must not be used to quote string literal values.
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
 }
 
 func databaseNameForObjectKey(databaseObjKey client.ObjectKey) string {
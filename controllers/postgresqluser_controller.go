@@ -0,0 +1,535 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/jackc/pgx/v4"
+	platformv1 "github.com/jaym/kube-dev-env/api/v1"
+	"github.com/jaym/kube-dev-env/pkg/password"
+	"github.com/jaym/kube-dev-env/pkg/provisioner"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// PostgreSQLUserReconciler reconciles a PostgreSQLUser object
+type PostgreSQLUserReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+	// PGConfig is configuration to connect to the default backend instance
+	// with superuser credentials, used when the referenced Database does not
+	// set Spec.InstanceRef.
+	PGConfig PGConfig
+	// PasswordLength and PasswordCharset configure generated passwords; see
+	// password.Generate for their defaults when left zero.
+	PasswordLength  int
+	PasswordCharset string
+
+	provisioners provisionerCache
+}
+
+// +kubebuilder:rbac:groups=platform.dev.env,resources=postgresqlusers,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=platform.dev.env,resources=postgresqlusers/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=platform.dev.env,resources=databaseinstances,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+
+func (r *PostgreSQLUserReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("postgresqluser", req.NamespacedName)
+
+	var user platformv1.PostgreSQLUser
+	if err := r.Client.Get(ctx, req.NamespacedName, &user); err != nil {
+		log.Error(err, "failed to get postgresqluser")
+		return ctrl.Result{}, err
+	}
+
+	databaseKey := client.ObjectKey{Namespace: req.Namespace, Name: user.Spec.DatabaseRef.Name}
+	var database platformv1.Database
+	if err := r.Client.Get(ctx, databaseKey, &database); err != nil {
+		log.Error(err, "failed to get referenced database", "database", databaseKey)
+		return ctrl.Result{}, err
+	}
+
+	reconcileErr := r.ensureUserAndSecret(ctx, log, &user, &database)
+	if reconcileErr == nil {
+		reconcileErr = r.ensureGrants(ctx, log, &user, &database)
+	}
+
+	if err := r.Client.Status().Update(ctx, &user); err != nil {
+		log.Error(err, "failed to update postgresqluser status")
+		if reconcileErr == nil {
+			reconcileErr = err
+		}
+	}
+
+	if reconcileErr != nil {
+		return ctrl.Result{}, reconcileErr
+	}
+
+	result := ctrl.Result{}
+	if user.Spec.RotationInterval != nil {
+		result.RequeueAfter = user.Spec.RotationInterval.Duration
+	}
+	return result, nil
+}
+
+// resolveInstance returns the superuser connection details the role backing
+// user should be provisioned through, resolved from database's
+// Spec.InstanceRef the same way DatabaseReconciler resolves it.
+func (r *PostgreSQLUserReconciler) resolveInstance(ctx context.Context, database *platformv1.Database) (provisioner.Config, provisionerCacheKey, error) {
+	return resolveInstanceConfig(ctx, r.Client, database.Namespace, database.Spec.InstanceRef.Name, database.Spec.Type, r.PGConfig)
+}
+
+// provisionerFor returns the DatabaseProvisioner for database, building and
+// caching one on first use per resolveInstance's cache key.
+func (r *PostgreSQLUserReconciler) provisionerFor(ctx context.Context, database *platformv1.Database) (provisioner.DatabaseProvisioner, error) {
+	cfg, key, err := r.resolveInstance(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+	return r.provisioners.getOrCreate(ctx, key, cfg)
+}
+
+// Start implements manager.Runnable, closing every cached provisioner pool
+// when the manager shuts down. Register it alongside the reconciler via
+// mgr.Add(r) in SetupWithManager's caller.
+func (r *PostgreSQLUserReconciler) Start(ctx context.Context) error {
+	<-ctx.Done()
+	r.provisioners.closeAll()
+	return nil
+}
+
+// ensureUserAndSecret ensures the role backing user exists on the instance
+// database is provisioned against and that its credentials are available in
+// a Secret, mirroring DatabaseReconciler.ensureDatabaseAndSecret's
+// rotate/LastRotated handling but without creating a database of its own.
+func (r *PostgreSQLUserReconciler) ensureUserAndSecret(ctx context.Context, log logr.Logger, user *platformv1.PostgreSQLUser, database *platformv1.Database) error {
+	userObjKey := client.ObjectKeyFromObject(user)
+	secKey := objectKeyForPostgreSQLUserSecret(userObjKey, user.Spec.Credentials)
+
+	var sec corev1.Secret
+	secExists := true
+	if err := r.Client.Get(ctx, secKey, &sec); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		secExists = false
+	}
+
+	rotate := !secExists || user.Status.LastRotated == nil
+	if !rotate && user.Spec.RotationInterval != nil {
+		rotate = time.Since(user.Status.LastRotated.Time) >= user.Spec.RotationInterval.Duration
+	}
+
+	cfg, err := r.pgConnConfigFor(ctx, database, userObjKey)
+	if err != nil {
+		log.Error(err, "failed to resolve instance connection details")
+		return err
+	}
+
+	if rotate {
+		meta.SetStatusCondition(&user.Status.Conditions, metav1.Condition{
+			Type:   platformv1.ConditionTypeRotating,
+			Status: metav1.ConditionTrue,
+			Reason: "RotatingPassword",
+		})
+		newPassword, err := password.Generate(r.PasswordLength, r.PasswordCharset)
+		if err != nil {
+			log.Error(err, "failed to generate password")
+			return err
+		}
+		cfg.Password = newPassword
+	} else if existing, ok := sec.Data[passwordSecretKey]; ok {
+		cfg.Password = string(existing)
+	} else {
+		err := fmt.Errorf("secret %s is missing the reserved %q key", secKey, passwordSecretKey)
+		log.Error(err, "cannot reuse existing password")
+		return err
+	}
+
+	p, err := r.provisionerFor(ctx, database)
+	if err != nil {
+		log.Error(err, "failed to get provisioner", "type", database.Spec.Type)
+		return err
+	}
+
+	if err := p.EnsureRole(ctx, cfg.User, cfg.Password); err != nil {
+		log.Error(err, "failed to ensure role", "role", cfg.User)
+		meta.SetStatusCondition(&user.Status.Conditions, metav1.Condition{
+			Type: platformv1.ConditionTypeRoleCreated, Status: metav1.ConditionFalse, Reason: "EnsureRoleFailed", Message: err.Error(),
+		})
+		return err
+	}
+	meta.SetStatusCondition(&user.Status.Conditions, metav1.Condition{
+		Type: platformv1.ConditionTypeRoleCreated, Status: metav1.ConditionTrue, Reason: "RoleEnsured",
+	})
+
+	newSec, err := cfg.ToSecret(secKey, nil)
+	if err != nil {
+		log.Error(err, "failed to render secret template")
+		return err
+	}
+	newSec.Data[passwordSecretKey] = []byte(cfg.Password)
+
+	if !secExists {
+		if err := controllerutil.SetControllerReference(user, newSec, r.Scheme); err != nil {
+			log.Error(err, "failed to set controller reference on secret")
+		}
+		if err := r.Client.Create(ctx, newSec); err != nil {
+			log.Error(err, "failed to create secret")
+			meta.SetStatusCondition(&user.Status.Conditions, metav1.Condition{
+				Type: platformv1.ConditionTypeSecretSynced, Status: metav1.ConditionFalse, Reason: "CreateFailed", Message: err.Error(),
+			})
+			return err
+		}
+	} else {
+		sec.Data = newSec.Data
+		if err := r.Client.Update(ctx, &sec); err != nil {
+			log.Error(err, "failed to update secret")
+			meta.SetStatusCondition(&user.Status.Conditions, metav1.Condition{
+				Type: platformv1.ConditionTypeSecretSynced, Status: metav1.ConditionFalse, Reason: "UpdateFailed", Message: err.Error(),
+			})
+			return err
+		}
+	}
+	meta.SetStatusCondition(&user.Status.Conditions, metav1.Condition{
+		Type: platformv1.ConditionTypeSecretSynced, Status: metav1.ConditionTrue, Reason: "SecretSynced",
+	})
+
+	if rotate {
+		now := metav1.Now()
+		user.Status.LastRotated = &now
+		meta.SetStatusCondition(&user.Status.Conditions, metav1.Condition{
+			Type: platformv1.ConditionTypeRotating, Status: metav1.ConditionFalse, Reason: "RotationComplete",
+		})
+	} else if user.Spec.RotationInterval == nil {
+		meta.SetStatusCondition(&user.Status.Conditions, metav1.Condition{
+			Type: platformv1.ConditionTypeRotating, Status: metav1.ConditionFalse, Reason: "RotationDisabled",
+		})
+	}
+
+	provisioned := true
+	user.Status.Provisioned = &provisioned
+
+	return nil
+}
+
+// ensureGrants diffs user.Spec.Grants against the privileges the role
+// actually holds in database, issuing GRANT/REVOKE statements to converge.
+// It connects with the instance's superuser credentials, since granting
+// privileges on behalf of another role requires them.
+func (r *PostgreSQLUserReconciler) ensureGrants(ctx context.Context, log logr.Logger, user *platformv1.PostgreSQLUser, database *platformv1.Database) error {
+	instanceCfg, _, err := r.resolveInstance(ctx, database)
+	if err != nil {
+		log.Error(err, "failed to resolve instance connection details")
+		return err
+	}
+
+	dbName := databaseNameForObjectKey(client.ObjectKeyFromObject(database))
+	role := roleNameForObjectKey(client.ObjectKeyFromObject(user))
+
+	conn, err := provisioner.Connect(ctx, instanceCfg, dbName)
+	if err != nil {
+		log.Error(err, "failed to connect to database to reconcile grants", "database", dbName)
+		return err
+	}
+	defer conn.Close(ctx)
+
+	desired := map[grantKey]bool{}
+	for _, g := range user.Spec.Grants {
+		var schema, name string
+		switch g.Object {
+		case platformv1.GrantObjectTable:
+			schema, name = splitSchemaQualified(g.ObjectName)
+		case platformv1.GrantObjectDatabase:
+			// ObjectName is ignored; the grant targets dbName.
+		default:
+			name = g.ObjectName
+		}
+		for _, priv := range g.Privileges {
+			p := strings.ToUpper(string(priv))
+			if !validPrivileges[p] {
+				err := fmt.Errorf("grant on %s %q: unsupported privilege %q", g.Object, g.ObjectName, priv)
+				log.Error(err, "rejecting invalid privilege")
+				return err
+			}
+			for _, expanded := range expandPrivilege(p, g.Object) {
+				desired[grantKey{object: g.Object, schema: schema, objectName: name, privilege: expanded}] = g.WithGrantOption
+			}
+		}
+	}
+
+	actual, err := r.currentGrants(ctx, conn, role, user.Spec.Grants)
+	if err != nil {
+		log.Error(err, "failed to determine current grants", "role", role)
+		return err
+	}
+
+	for key, withGrantOption := range desired {
+		if actual[key] {
+			continue
+		}
+		stmt := fmt.Sprintf("GRANT %s ON %s %s TO %s", key.privilege, key.object, grantTargetSQL(key, dbName), quoteIdentifier(role))
+		if withGrantOption {
+			stmt += " WITH GRANT OPTION"
+		}
+		if _, err := conn.Exec(ctx, stmt); err != nil {
+			log.Error(err, "failed to grant privilege", "role", role, "grant", key)
+			return err
+		}
+	}
+
+	for key := range actual {
+		if _, ok := desired[key]; ok {
+			continue
+		}
+		stmt := fmt.Sprintf("REVOKE %s ON %s %s FROM %s", key.privilege, key.object, grantTargetSQL(key, dbName), quoteIdentifier(role))
+		if _, err := conn.Exec(ctx, stmt); err != nil {
+			log.Error(err, "failed to revoke privilege", "role", role, "grant", key)
+			return err
+		}
+	}
+
+	meta.SetStatusCondition(&user.Status.Conditions, metav1.Condition{
+		Type:   "GrantsReady",
+		Status: metav1.ConditionTrue,
+		Reason: "GrantsReconciled",
+	})
+
+	return nil
+}
+
+// grantKey identifies a single privilege a role either does or doesn't hold.
+// schema is only meaningful for TABLE grants; it is left empty for SCHEMA,
+// SEQUENCE, and DATABASE grants, whose ObjectName is not schema-qualified.
+type grantKey struct {
+	object     platformv1.GrantObjectType
+	schema     string
+	objectName string
+	privilege  string
+}
+
+// splitSchemaQualified splits objectName into a schema and bare name,
+// defaulting to the public schema when objectName has no "." separator.
+func splitSchemaQualified(objectName string) (schema, name string) {
+	if schema, name, ok := strings.Cut(objectName, "."); ok {
+		return schema, name
+	}
+	return "public", objectName
+}
+
+// grantTargetSQL renders the "ON <object> <name>" target of a GRANT/REVOKE
+// statement. DATABASE grants take the already-resolved, quoted database
+// name, since "GRANT ... ON DATABASE" expects a bare identifier rather than
+// a function call. TABLE grants are schema-qualified since table names are
+// only unique within a schema.
+func grantTargetSQL(key grantKey, dbName string) string {
+	switch key.object {
+	case platformv1.GrantObjectDatabase:
+		return quoteIdentifier(dbName)
+	case platformv1.GrantObjectTable:
+		return quoteIdentifier(key.schema) + "." + quoteIdentifier(key.objectName)
+	default:
+		return quoteIdentifier(key.objectName)
+	}
+}
+
+// validPrivileges is the allow-list of privilege keywords that may be
+// interpolated into a GRANT/REVOKE statement. It is checked again here even
+// though Grant.Privileges is already enum-validated by the CRD schema, since
+// a reconciler must not trust that every object it reads satisfies
+// validation added after it was written.
+var validPrivileges = map[string]bool{
+	"SELECT":     true,
+	"INSERT":     true,
+	"UPDATE":     true,
+	"DELETE":     true,
+	"TRUNCATE":   true,
+	"REFERENCES": true,
+	"TRIGGER":    true,
+	"USAGE":      true,
+	"CREATE":     true,
+	"CONNECT":    true,
+	"TEMPORARY":  true,
+	"EXECUTE":    true,
+	"ALL":        true,
+}
+
+// allPrivilegesByObject lists the concrete privileges ALL expands to for
+// each object type, so it can be diffed against currentGrants' catalog rows
+// the same way an explicit list would be, instead of the literal string
+// "ALL" which never matches a real privilege_type and would otherwise be
+// granted and revoked on every other reconcile.
+var allPrivilegesByObject = map[platformv1.GrantObjectType][]string{
+	platformv1.GrantObjectTable:    {"SELECT", "INSERT", "UPDATE", "DELETE", "TRUNCATE", "REFERENCES", "TRIGGER"},
+	platformv1.GrantObjectSequence: {"USAGE", "SELECT", "UPDATE"},
+	platformv1.GrantObjectSchema:   {"USAGE", "CREATE"},
+	platformv1.GrantObjectDatabase: {"CREATE", "CONNECT", "TEMPORARY"},
+}
+
+// expandPrivilege returns the concrete privileges priv stands for against
+// object, expanding ALL via allPrivilegesByObject and passing any other
+// already-validated privilege through unchanged.
+func expandPrivilege(priv string, object platformv1.GrantObjectType) []string {
+	if priv != "ALL" {
+		return []string{priv}
+	}
+	return allPrivilegesByObject[object]
+}
+
+// currentGrants reports the privileges role actually holds, scoped to the
+// objects named in wantGrants. Table privileges are read from
+// information_schema.role_table_grants, matched on table_schema as well as
+// table_name since two schemas may each have a table with the same name;
+// schema and database privileges are read via the has_*_privilege
+// introspection functions against pg_namespace/pg_database, since ACL
+// entries there are not exposed through information_schema.
+func (r *PostgreSQLUserReconciler) currentGrants(ctx context.Context, conn *pgx.Conn, role string, wantGrants []platformv1.Grant) (map[grantKey]bool, error) {
+	actual := map[grantKey]bool{}
+
+	type tableKey struct{ schema, name string }
+	tables := map[tableKey]bool{}
+	schemas := map[string]bool{}
+	sequences := map[string]bool{}
+	wantsDatabase := false
+	for _, g := range wantGrants {
+		switch g.Object {
+		case platformv1.GrantObjectTable:
+			schema, name := splitSchemaQualified(g.ObjectName)
+			tables[tableKey{schema: schema, name: name}] = true
+		case platformv1.GrantObjectSchema:
+			schemas[g.ObjectName] = true
+		case platformv1.GrantObjectSequence:
+			sequences[g.ObjectName] = true
+		case platformv1.GrantObjectDatabase:
+			wantsDatabase = true
+		}
+	}
+
+	if len(tables) > 0 {
+		rows, err := conn.Query(ctx,
+			`SELECT table_schema, table_name, privilege_type FROM information_schema.role_table_grants WHERE grantee=$1`, role)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var tableSchema, tableName, privilege string
+			if err := rows.Scan(&tableSchema, &tableName, &privilege); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if tables[tableKey{schema: tableSchema, name: tableName}] {
+				actual[grantKey{object: platformv1.GrantObjectTable, schema: tableSchema, objectName: tableName, privilege: privilege}] = true
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	for schema := range schemas {
+		for _, priv := range []string{"USAGE", "CREATE"} {
+			row := conn.QueryRow(ctx, `SELECT has_schema_privilege($1, $2, $3)`, role, schema, priv)
+			var ok bool
+			if err := row.Scan(&ok); err != nil {
+				return nil, err
+			}
+			if ok {
+				actual[grantKey{object: platformv1.GrantObjectSchema, objectName: schema, privilege: priv}] = true
+			}
+		}
+	}
+
+	for seq := range sequences {
+		for _, priv := range []string{"USAGE", "SELECT", "UPDATE"} {
+			row := conn.QueryRow(ctx, `SELECT has_sequence_privilege($1, $2, $3)`, role, seq, priv)
+			var ok bool
+			if err := row.Scan(&ok); err != nil {
+				return nil, err
+			}
+			if ok {
+				actual[grantKey{object: platformv1.GrantObjectSequence, objectName: seq, privilege: priv}] = true
+			}
+		}
+	}
+
+	if wantsDatabase {
+		for _, priv := range []string{"CONNECT", "CREATE", "TEMPORARY"} {
+			row := conn.QueryRow(ctx, `SELECT has_database_privilege($1, current_database(), $2)`, role, priv)
+			var ok bool
+			if err := row.Scan(&ok); err != nil {
+				return nil, err
+			}
+			if ok {
+				actual[grantKey{object: platformv1.GrantObjectDatabase, privilege: priv}] = true
+			}
+		}
+	}
+
+	return actual, nil
+}
+
+// pgConnConfigFor returns connection details for the role backing userObjKey,
+// on whichever instance database.Spec.InstanceRef resolves to. The caller is
+// responsible for setting Password, since it may need to be generated or
+// read back from the existing Secret.
+func (r *PostgreSQLUserReconciler) pgConnConfigFor(ctx context.Context, database *platformv1.Database, userObjKey client.ObjectKey) (PGConfig, error) {
+	instanceCfg, _, err := r.resolveInstance(ctx, database)
+	if err != nil {
+		return PGConfig{}, err
+	}
+
+	return PGConfig{
+		Host:     instanceCfg.Host,
+		Port:     instanceCfg.Port,
+		Database: databaseNameForObjectKey(client.ObjectKeyFromObject(database)),
+		User:     roleNameForObjectKey(userObjKey),
+	}, nil
+}
+
+// objectKeyForPostgreSQLUserSecret returns the Secret credentials should be
+// written to, honoring credentials when set and falling back to
+// postgresqluser-creds-<name> otherwise.
+func objectKeyForPostgreSQLUserSecret(userObjKey client.ObjectKey, credentials corev1.LocalObjectReference) client.ObjectKey {
+	if credentials.Name != "" {
+		return client.ObjectKey{Namespace: userObjKey.Namespace, Name: credentials.Name}
+	}
+	return client.ObjectKey{
+		Namespace: userObjKey.Namespace,
+		Name:      fmt.Sprintf("postgresqluser-creds-%s", userObjKey.Name),
+	}
+}
+
+func (r *PostgreSQLUserReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&platformv1.PostgreSQLUser{}).
+		Owns(&corev1.Secret{}).
+		Complete(r)
+}
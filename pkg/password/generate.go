@@ -0,0 +1,53 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package password generates cryptographically random passwords for
+// database credentials.
+package password
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// DefaultLength is used by Generate when no length is given.
+const DefaultLength = 32
+
+// DefaultCharset is used by Generate when no charset is given.
+const DefaultCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// Generate returns a cryptographically random password of length characters
+// drawn from charset. A length <= 0 defaults to DefaultLength, and an empty
+// charset defaults to DefaultCharset.
+func Generate(length int, charset string) (string, error) {
+	if length <= 0 {
+		length = DefaultLength
+	}
+	if charset == "" {
+		charset = DefaultCharset
+	}
+
+	raw := make([]byte, length)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("password: read random bytes: %w", err)
+	}
+
+	out := make([]byte, length)
+	for i, b := range raw {
+		out[i] = charset[int(b)%len(charset)]
+	}
+	return string(out), nil
+}
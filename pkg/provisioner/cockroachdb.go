@@ -0,0 +1,131 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provisioner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	platformv1 "github.com/jaym/kube-dev-env/api/v1"
+)
+
+func init() {
+	Register(platformv1.DatabaseTypeCockroachDB, newCockroachDBProvisioner)
+}
+
+// cockroachProvisioner provisions roles and databases against CockroachDB.
+// CockroachDB speaks the Postgres wire protocol, so it reuses pgx, but its
+// SQL dialect diverges from Postgres in ways that matter here: there is no
+// pg_authid (role existence is checked via pg_roles/SHOW ROLES instead),
+// no tablespaces, no pg_advisory_xact_lock, and CREATE DATABASE does not
+// accept an OWNER clause (ownership is granted separately).
+type cockroachProvisioner struct {
+	cfg  Config
+	pool *pgxpool.Pool
+}
+
+func newCockroachDBProvisioner(cfg Config) (DatabaseProvisioner, error) {
+	poolCfg, err := pgxpool.ParseConfig(connString(cfg, cfg.Database))
+	if err != nil {
+		return nil, fmt.Errorf("provisioner: parse connection string: %w", err)
+	}
+	if err := applyConnectionOptions(poolCfg.ConnConfig, cfg); err != nil {
+		return nil, err
+	}
+
+	pool, err := pgxpool.ConnectConfig(context.Background(), poolCfg)
+	if err != nil {
+		return nil, fmt.Errorf("provisioner: connect to cockroachdb: %w", err)
+	}
+	return &cockroachProvisioner{cfg: cfg, pool: pool}, nil
+}
+
+func (p *cockroachProvisioner) EnsureRole(ctx context.Context, role, password string) error {
+	var unused string
+	row := p.pool.QueryRow(ctx, `SELECT rolname FROM pg_catalog.pg_roles WHERE rolname=$1`, role)
+	roleExists := true
+	if err := row.Scan(&unused); err != nil {
+		if err != pgx.ErrNoRows {
+			return fmt.Errorf("provisioner: check role %q exists: %w", role, err)
+		}
+		roleExists = false
+	}
+
+	if !roleExists {
+		if _, err := p.pool.Exec(ctx, fmt.Sprintf(
+			`CREATE USER %s WITH PASSWORD '%s'`, quoteIdentifier(role), password)); err != nil {
+			return fmt.Errorf("provisioner: create role %q: %w", role, err)
+		}
+		return nil
+	}
+
+	if _, err := p.pool.Exec(ctx, fmt.Sprintf(`ALTER USER %s WITH PASSWORD '%s'`, quoteIdentifier(role), password)); err != nil {
+		return fmt.Errorf("provisioner: set password for role %q: %w", role, err)
+	}
+	return nil
+}
+
+func (p *cockroachProvisioner) EnsureDatabase(ctx context.Context, database, owner string) error {
+	var unused string
+	row := p.pool.QueryRow(ctx, `SELECT datname FROM pg_catalog.pg_database WHERE datname=$1`, database)
+	if err := row.Scan(&unused); err == nil {
+		return nil
+	} else if err != pgx.ErrNoRows {
+		return fmt.Errorf("provisioner: check database %q exists: %w", database, err)
+	}
+
+	// CREATE DATABASE ... OWNER is not supported; grant ownership
+	// separately via ALTER DATABASE ... OWNER TO.
+	if _, err := p.pool.Exec(ctx, fmt.Sprintf(`CREATE DATABASE %s`, quoteIdentifier(database))); err != nil {
+		return fmt.Errorf("provisioner: create database %q: %w", database, err)
+	}
+	if _, err := p.pool.Exec(ctx, fmt.Sprintf(
+		`ALTER DATABASE %s OWNER TO %s`, quoteIdentifier(database), quoteIdentifier(owner))); err != nil {
+		return fmt.Errorf("provisioner: set owner of database %q to %q: %w", database, owner, err)
+	}
+	return nil
+}
+
+// EnsureExtensions is a no-op: CockroachDB does not support CREATE
+// EXTENSION, so every requested extension is reported as unavailable.
+func (p *cockroachProvisioner) EnsureExtensions(ctx context.Context, database string, previouslyInstalled, extensions []string) ([]string, []string, error) {
+	return nil, extensions, nil
+}
+
+func (p *cockroachProvisioner) Drop(ctx context.Context, database, role string) error {
+	if database != "" {
+		if _, err := p.pool.Exec(ctx, fmt.Sprintf(`DROP DATABASE IF EXISTS %s CASCADE`, quoteIdentifier(database))); err != nil {
+			return fmt.Errorf("provisioner: drop database %q: %w", database, err)
+		}
+	}
+	if role != "" {
+		if _, err := p.pool.Exec(ctx, fmt.Sprintf(`DROP ROLE IF EXISTS %s`, quoteIdentifier(role))); err != nil {
+			return fmt.Errorf("provisioner: drop role %q: %w", role, err)
+		}
+	}
+	return nil
+}
+
+func (p *cockroachProvisioner) Ping(ctx context.Context) error {
+	return p.pool.Ping(ctx)
+}
+
+func (p *cockroachProvisioner) Close() {
+	p.pool.Close()
+}
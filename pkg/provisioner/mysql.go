@@ -0,0 +1,106 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provisioner
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	_ "github.com/go-sql-driver/mysql"
+	platformv1 "github.com/jaym/kube-dev-env/api/v1"
+)
+
+func init() {
+	Register(platformv1.DatabaseTypeMySQL, newMySQLProvisioner)
+}
+
+// mysqlProvisioner provisions users and databases against a MySQL instance.
+// MySQL has no extension mechanism comparable to Postgres', so
+// EnsureExtensions is a no-op that reports every requested extension as
+// unavailable.
+type mysqlProvisioner struct {
+	db *sql.DB
+}
+
+func newMySQLProvisioner(cfg Config) (DatabaseProvisioner, error) {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/", cfg.User, cfg.Password, cfg.Host, cfg.Port)
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("provisioner: connect to mysql: %w", err)
+	}
+	return &mysqlProvisioner{db: db}, nil
+}
+
+func (p *mysqlProvisioner) EnsureRole(ctx context.Context, role, password string) error {
+	if _, err := p.db.ExecContext(ctx, fmt.Sprintf(
+		"CREATE USER IF NOT EXISTS %s IDENTIFIED BY '%s'", quoteMySQLIdentifier(role), password)); err != nil {
+		return fmt.Errorf("provisioner: create user %q: %w", role, err)
+	}
+	if _, err := p.db.ExecContext(ctx, fmt.Sprintf(
+		"ALTER USER %s IDENTIFIED BY '%s'", quoteMySQLIdentifier(role), password)); err != nil {
+		return fmt.Errorf("provisioner: set password for user %q: %w", role, err)
+	}
+	return nil
+}
+
+func (p *mysqlProvisioner) EnsureDatabase(ctx context.Context, database, owner string) error {
+	if _, err := p.db.ExecContext(ctx, fmt.Sprintf(
+		"CREATE DATABASE IF NOT EXISTS %s", quoteMySQLIdentifier(database))); err != nil {
+		return fmt.Errorf("provisioner: create database %q: %w", database, err)
+	}
+	if _, err := p.db.ExecContext(ctx, fmt.Sprintf(
+		"GRANT ALL PRIVILEGES ON %s.* TO %s", quoteMySQLIdentifier(database), quoteMySQLIdentifier(owner))); err != nil {
+		return fmt.Errorf("provisioner: grant ownership of database %q to %q: %w", database, owner, err)
+	}
+	return nil
+}
+
+func (p *mysqlProvisioner) EnsureExtensions(ctx context.Context, database string, previouslyInstalled, extensions []string) ([]string, []string, error) {
+	return nil, extensions, nil
+}
+
+func (p *mysqlProvisioner) Drop(ctx context.Context, database, role string) error {
+	if database != "" {
+		if _, err := p.db.ExecContext(ctx, fmt.Sprintf("DROP DATABASE IF EXISTS %s", quoteMySQLIdentifier(database))); err != nil {
+			return fmt.Errorf("provisioner: drop database %q: %w", database, err)
+		}
+	}
+	if role != "" {
+		if _, err := p.db.ExecContext(ctx, fmt.Sprintf("DROP USER IF EXISTS %s", quoteMySQLIdentifier(role))); err != nil {
+			return fmt.Errorf("provisioner: drop user %q: %w", role, err)
+		}
+	}
+	return nil
+}
+
+func (p *mysqlProvisioner) Ping(ctx context.Context) error {
+	return p.db.PingContext(ctx)
+}
+
+func (p *mysqlProvisioner) Close() {
+	p.db.Close()
+}
+
+// quoteMySQLIdentifier quotes name for safe interpolation into a SQL
+// statement as a MySQL identifier, which is backtick-delimited rather than
+// double-quote-delimited like Postgres. As with quoteIdentifier, an
+// embedded delimiter must be doubled rather than escaped.
+func quoteMySQLIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
@@ -0,0 +1,191 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	platformv1 "github.com/jaym/kube-dev-env/api/v1"
+)
+
+func init() {
+	Register(platformv1.DatabaseTypePostgres, newPostgresProvisioner)
+}
+
+// postgresProvisioner provisions roles and databases against a Postgres
+// instance using the admin pool.
+type postgresProvisioner struct {
+	cfg  Config
+	pool *pgxpool.Pool
+}
+
+func newPostgresProvisioner(cfg Config) (DatabaseProvisioner, error) {
+	poolCfg, err := pgxpool.ParseConfig(connString(cfg, cfg.Database))
+	if err != nil {
+		return nil, fmt.Errorf("provisioner: parse connection string: %w", err)
+	}
+	if err := applyConnectionOptions(poolCfg.ConnConfig, cfg); err != nil {
+		return nil, err
+	}
+
+	pool, err := pgxpool.ConnectConfig(context.Background(), poolCfg)
+	if err != nil {
+		return nil, fmt.Errorf("provisioner: connect to postgres: %w", err)
+	}
+	return &postgresProvisioner{cfg: cfg, pool: pool}, nil
+}
+
+func connString(cfg Config, database string) string {
+	return fmt.Sprintf("postgres://%s:%s@%s:%d/%s",
+		url.QueryEscape(cfg.User), url.QueryEscape(cfg.Password), cfg.Host, cfg.Port, url.QueryEscape(database))
+}
+
+// quoteIdentifier quotes name for safe interpolation into a SQL statement as
+// an identifier, equivalent to pq.QuoteIdentifier. It must not be used to
+// quote string literal values.
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func (p *postgresProvisioner) EnsureRole(ctx context.Context, role, password string) error {
+	var unused string
+	row := p.pool.QueryRow(ctx, `SELECT rolname FROM pg_catalog.pg_authid WHERE rolname=$1`, role)
+	roleExists := true
+	if err := row.Scan(&unused); err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("provisioner: check role %q exists: %w", role, err)
+		}
+		roleExists = false
+	}
+
+	if !roleExists {
+		if _, err := p.pool.Exec(ctx, fmt.Sprintf("CREATE USER %s", quoteIdentifier(role))); err != nil {
+			return fmt.Errorf("provisioner: create role %q: %w", role, err)
+		}
+	}
+
+	if _, err := p.pool.Exec(ctx, fmt.Sprintf(`ALTER USER %s WITH PASSWORD '%s'`, quoteIdentifier(role), password)); err != nil {
+		return fmt.Errorf("provisioner: set password for role %q: %w", role, err)
+	}
+
+	return nil
+}
+
+func (p *postgresProvisioner) EnsureDatabase(ctx context.Context, database, owner string) error {
+	var unused string
+	row := p.pool.QueryRow(ctx, `SELECT datname FROM pg_catalog.pg_database WHERE datname=$1`, database)
+	if err := row.Scan(&unused); err == nil {
+		return nil
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("provisioner: check database %q exists: %w", database, err)
+	}
+
+	if _, err := p.pool.Exec(ctx, fmt.Sprintf(
+		`CREATE DATABASE %s OWNER %s`, quoteIdentifier(database), quoteIdentifier(owner))); err != nil {
+		return fmt.Errorf("provisioner: create database %q: %w", database, err)
+	}
+	return nil
+}
+
+func (p *postgresProvisioner) EnsureExtensions(ctx context.Context, database string, previouslyInstalled, extensions []string) ([]string, []string, error) {
+	connCfg, err := connectConfig(p.cfg, database)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, err := pgx.ConnectConfig(ctx, connCfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("provisioner: connect to database %q: %w", database, err)
+	}
+	defer conn.Close(ctx)
+
+	available := map[string]bool{}
+	rows, err := conn.Query(ctx, `SELECT name FROM pg_catalog.pg_available_extensions`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("provisioner: list available extensions: %w", err)
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		available[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	desired := map[string]bool{}
+	for _, ext := range extensions {
+		desired[ext] = true
+	}
+
+	var installed, unavailable []string
+	for _, ext := range extensions {
+		if !available[ext] {
+			unavailable = append(unavailable, ext)
+			continue
+		}
+		if _, err := conn.Exec(ctx, fmt.Sprintf(`CREATE EXTENSION IF NOT EXISTS %s`, quoteIdentifier(ext))); err != nil {
+			return nil, nil, fmt.Errorf("provisioner: create extension %q: %w", ext, err)
+		}
+		installed = append(installed, ext)
+	}
+
+	// Only extensions this operator previously installed are candidates for
+	// removal; anything else present in the database (plpgsql by default,
+	// or extensions installed by other tooling) is left alone.
+	for _, ext := range previouslyInstalled {
+		if desired[ext] {
+			continue
+		}
+		if _, err := conn.Exec(ctx, fmt.Sprintf(`DROP EXTENSION IF EXISTS %s`, quoteIdentifier(ext))); err != nil {
+			return nil, nil, fmt.Errorf("provisioner: drop extension %q: %w", ext, err)
+		}
+	}
+
+	return installed, unavailable, nil
+}
+
+func (p *postgresProvisioner) Drop(ctx context.Context, database, role string) error {
+	if database != "" {
+		if _, err := p.pool.Exec(ctx, fmt.Sprintf(`DROP DATABASE IF EXISTS %s`, quoteIdentifier(database))); err != nil {
+			return fmt.Errorf("provisioner: drop database %q: %w", database, err)
+		}
+	}
+	if role != "" {
+		if _, err := p.pool.Exec(ctx, fmt.Sprintf(`DROP ROLE IF EXISTS %s`, quoteIdentifier(role))); err != nil {
+			return fmt.Errorf("provisioner: drop role %q: %w", role, err)
+		}
+	}
+	return nil
+}
+
+func (p *postgresProvisioner) Ping(ctx context.Context) error {
+	return p.pool.Ping(ctx)
+}
+
+func (p *postgresProvisioner) Close() {
+	p.pool.Close()
+}
@@ -0,0 +1,95 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package provisioner abstracts database-backend-specific provisioning
+// (Postgres, MySQL, CockroachDB, ...) behind a single DatabaseProvisioner
+// interface, so DatabaseReconciler can stay backend-agnostic.
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	platformv1 "github.com/jaym/kube-dev-env/api/v1"
+)
+
+// Config carries the superuser connection details needed to provision
+// databases and roles on a backend instance.
+type Config struct {
+	Host     string
+	Port     uint16
+	Database string
+	User     string
+	Password string
+
+	// SSLMode controls whether and how the connection is encrypted and
+	// verified. An empty value is treated as platformv1.SSLModeDisable.
+	SSLMode platformv1.SSLMode
+	// CABundle is the PEM-encoded CA bundle to verify the server's
+	// certificate against when SSLMode is verify-ca or verify-full.
+	CABundle []byte
+	// ConnectTimeout bounds how long a new connection attempt may take. A
+	// zero value leaves the driver's own default in place.
+	ConnectTimeout time.Duration
+	// ApplicationName is reported to the backend via the application_name
+	// connection parameter.
+	ApplicationName string
+}
+
+// DatabaseProvisioner manages the lifecycle of a role and the database it
+// owns against a specific backend.
+type DatabaseProvisioner interface {
+	// EnsureRole creates role with password if it does not already exist,
+	// and resets its password if it does.
+	EnsureRole(ctx context.Context, role, password string) error
+	// EnsureDatabase creates database owned by owner if it does not already
+	// exist.
+	EnsureDatabase(ctx context.Context, database, owner string) error
+	// EnsureExtensions installs extensions in database and drops any
+	// extension in previouslyInstalled that is no longer present in
+	// extensions. Extensions present in database but absent from both lists
+	// (for example ones installed by the backend itself, or by other
+	// tooling) are left untouched. It returns the extensions now installed
+	// and any requested extensions that are unavailable on the backend.
+	EnsureExtensions(ctx context.Context, database string, previouslyInstalled, extensions []string) (installed []string, unavailable []string, err error)
+	// Drop removes database and role. Either may be empty to skip it.
+	Drop(ctx context.Context, database, role string) error
+	// Ping verifies connectivity to the backend.
+	Ping(ctx context.Context) error
+	// Close releases any connections held by the provisioner.
+	Close()
+}
+
+// Factory constructs a DatabaseProvisioner from cfg.
+type Factory func(cfg Config) (DatabaseProvisioner, error)
+
+var registry = map[platformv1.DatabaseType]Factory{}
+
+// Register associates dbType with a Factory. It is intended to be called
+// from init() in each backend's implementation file.
+func Register(dbType platformv1.DatabaseType, factory Factory) {
+	registry[dbType] = factory
+}
+
+// New builds the DatabaseProvisioner registered for dbType.
+func New(dbType platformv1.DatabaseType, cfg Config) (DatabaseProvisioner, error) {
+	factory, ok := registry[dbType]
+	if !ok {
+		return nil, fmt.Errorf("provisioner: no provisioner registered for database type %q", dbType)
+	}
+	return factory(cfg)
+}
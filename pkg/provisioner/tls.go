@@ -0,0 +1,133 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provisioner
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	platformv1 "github.com/jaym/kube-dev-env/api/v1"
+)
+
+// applyConnectionOptions configures connCfg's TLS, timeout, and
+// application_name settings from cfg. It is shared by the Postgres and
+// CockroachDB provisioners, since both speak the Postgres wire protocol.
+func applyConnectionOptions(connCfg *pgx.ConnConfig, cfg Config) error {
+	switch cfg.SSLMode {
+	case "", platformv1.SSLModeDisable:
+		connCfg.TLSConfig = nil
+	case platformv1.SSLModeRequire:
+		connCfg.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+	case platformv1.SSLModeVerifyCA:
+		roots := x509.NewCertPool()
+		if len(cfg.CABundle) > 0 {
+			roots.AppendCertsFromPEM(cfg.CABundle)
+		}
+		connCfg.TLSConfig = &tls.Config{
+			RootCAs: roots,
+			// Chain verification only; the hostname is intentionally not
+			// checked here, which is what separates verify-ca from
+			// verify-full.
+			InsecureSkipVerify:    true,
+			VerifyPeerCertificate: verifyChain(roots),
+		}
+	case platformv1.SSLModeVerifyFull:
+		roots := x509.NewCertPool()
+		if len(cfg.CABundle) > 0 {
+			roots.AppendCertsFromPEM(cfg.CABundle)
+		}
+		connCfg.TLSConfig = &tls.Config{
+			RootCAs:    roots,
+			ServerName: cfg.Host,
+		}
+	default:
+		return fmt.Errorf("provisioner: unsupported ssl mode %q", cfg.SSLMode)
+	}
+	// The connection string carries no sslmode, so parsing it adds a
+	// plaintext fallback that would be tried whenever the TLS attempt above
+	// fails; only the TLS settings chosen here are used.
+	connCfg.Fallbacks = nil
+
+	if cfg.ConnectTimeout > 0 {
+		connCfg.ConnectTimeout = cfg.ConnectTimeout
+	}
+	if cfg.ApplicationName != "" {
+		connCfg.RuntimeParams["application_name"] = cfg.ApplicationName
+	}
+	return nil
+}
+
+// verifyChain builds a tls.Config.VerifyPeerCertificate callback that
+// verifies the presented chain against roots without checking the server's
+// hostname, for SSLModeVerifyCA.
+func verifyChain(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("provisioner: server presented no certificate")
+		}
+
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return fmt.Errorf("provisioner: parse server certificate: %w", err)
+			}
+			certs[i] = cert
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+
+		_, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+		})
+		return err
+	}
+}
+
+// connectConfig parses connString into a *pgx.ConnConfig with cfg's
+// connection options applied.
+func connectConfig(cfg Config, database string) (*pgx.ConnConfig, error) {
+	connCfg, err := pgx.ParseConfig(connString(cfg, database))
+	if err != nil {
+		return nil, fmt.Errorf("provisioner: parse connection string: %w", err)
+	}
+	if err := applyConnectionOptions(connCfg, cfg); err != nil {
+		return nil, err
+	}
+	return connCfg, nil
+}
+
+// Connect opens a single ad-hoc connection to database using cfg's host,
+// port, credentials, and TLS settings, applying the same options EnsureRole,
+// EnsureDatabase, and EnsureExtensions connect with. It is exported for
+// callers outside this package that need raw SQL access beyond what the
+// DatabaseProvisioner interface exposes, such as reconciling per-role
+// grants.
+func Connect(ctx context.Context, cfg Config, database string) (*pgx.Conn, error) {
+	connCfg, err := connectConfig(cfg, database)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.ConnectConfig(ctx, connCfg)
+}